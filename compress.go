@@ -0,0 +1,44 @@
+package main
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedSuffixes are the file extensions isCompressed recognizes; the
+// actual decoding happens in decompress.
+var compressedSuffixes = []string{".gz", ".zst", ".bz2"}
+
+// isCompressed reports whether file's name indicates one of the compression
+// formats decompress knows how to handle.
+func isCompressed(file string) bool {
+	for _, suffix := range compressedSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decompress wraps r with the decompressor matching file's suffix, or
+// returns r unchanged if file isn't compressed.
+func decompress(file string, r io.Reader) (io.Reader, error) {
+	switch {
+	case strings.HasSuffix(file, ".gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(file, ".zst"):
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case strings.HasSuffix(file, ".bz2"):
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
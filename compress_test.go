@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestIsCompressed(t *testing.T) {
+	cases := map[string]bool{
+		"access.log":     false,
+		"access.log.gz":  true,
+		"access.log.zst": true,
+		"access.log.bz2": true,
+	}
+	for file, want := range cases {
+		if got := isCompressed(file); got != want {
+			t.Errorf("isCompressed(%q) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestDecompressGzipRoundTrip(t *testing.T) {
+	want := "hello gzip\n"
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := decompress("access.log.gz", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecompressZstdRoundTrip(t *testing.T) {
+	want := "hello zstd\n"
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := decompress("access.log.zst", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecompressBzip2RoundTrip(t *testing.T) {
+	// compress/bzip2 only implements a reader, so this is a small
+	// pre-built bzip2 stream for the literal "hello bzip2\n".
+	data := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xab, 0x6b,
+		0xa1, 0xf1, 0x00, 0x00, 0x02, 0xd9, 0x80, 0x00, 0x10, 0x40, 0x00, 0x10,
+		0x00, 0x12, 0x64, 0xc0, 0x10, 0x20, 0x00, 0x31, 0x00, 0xd3, 0x4d, 0x04,
+		0x00, 0x1e, 0xa3, 0xef, 0x4e, 0x51, 0xa2, 0x07, 0x8b, 0xb9, 0x22, 0x9c,
+		0x28, 0x48, 0x55, 0xb5, 0xd0, 0xf8, 0x80,
+	}
+	want := "hello bzip2\n"
+
+	r, err := decompress("access.log.bz2", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecompressUnrecognizedSuffixIsPassthrough(t *testing.T) {
+	want := "plain text\n"
+	r, err := decompress("access.log", bytes.NewReader([]byte(want)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoder turns one line of an access log into a Record. ok is false for
+// lines that should be silently skipped (e.g. blank lines); err is non-nil
+// for lines that don't match the expected schema at all.
+type Decoder interface {
+	Decode(line []byte) (rec Record, ok bool, err error)
+}
+
+// NewDecoder builds the Decoder selected by conf.InputFormat.
+func NewDecoder(conf Config) (Decoder, error) {
+	switch conf.InputFormat {
+	case "", "caddy-json":
+		return caddyJSONDecoder{}, nil
+	case "ndjson-generic":
+		fieldMap, err := parseFieldMap(conf.FieldMap)
+		if err != nil {
+			return nil, err
+		}
+		return ndjsonGenericDecoder{fieldMap: fieldMap}, nil
+	case "clf":
+		return apacheDecoder{pattern: clfPattern}, nil
+	case "combined":
+		return apacheDecoder{pattern: combinedPattern}, nil
+	default:
+		return nil, fmt.Errorf("unknown -input-format %q", conf.InputFormat)
+	}
+}
+
+// caddyJSONDecoder decodes Caddy's native JSON access log line, Record{}'s
+// longest-standing input schema.
+type caddyJSONDecoder struct{}
+
+type caddyLogLine struct {
+	Ts      float64 `json:"ts"`
+	Request struct {
+		RemoteAddr string              `json:"remote_addr"`
+		Method     string              `json:"method"`
+		Host       string              `json:"host"`
+		URI        string              `json:"uri"`
+		Headers    map[string][]string `json:"headers"`
+		TLS        struct {
+			Version     int `json:"version"`
+			CipherSuite int `json:"cipher_suite"`
+		} `json:"tls"`
+	} `json:"request"`
+	Duration    float64             `json:"duration"`
+	Size        int                 `json:"size"`
+	Status      int                 `json:"status"`
+	RespHeaders map[string][]string `json:"resp_headers"`
+}
+
+func (caddyJSONDecoder) Decode(line []byte) (Record, bool, error) {
+	var l caddyLogLine
+	if err := json.Unmarshal(line, &l); err != nil {
+		return Record{}, false, err
+	}
+
+	headers := normalizeHeaders(l.Request.Headers)
+	respHeaders := normalizeHeaders(l.RespHeaders)
+	contentType, _, _ := mime.ParseMediaType(respHeaders["content-type"])
+
+	return Record{
+		Ts:            l.Ts,
+		Host:          l.Request.Host,
+		RemoteAddr:    l.Request.RemoteAddr,
+		Method:        l.Request.Method,
+		URI:           l.Request.URI,
+		Status:        l.Status,
+		Size:          l.Size,
+		Duration:      l.Duration,
+		Referer:       headers["referer"],
+		UserAgent:     headers["user-agent"],
+		ContentType:   contentType,
+		Authorization: headers["authorization"],
+		TLSVersion:    l.Request.TLS.Version,
+		TLSCipher:     l.Request.TLS.CipherSuite,
+		proxyHeaders:  headers,
+	}, true, nil
+}
+
+func normalizeHeaders(h map[string][]string) map[string]string {
+	m := map[string]string{}
+	for k, v := range h {
+		if len(v) == 0 {
+			continue
+		}
+		m[strings.ToLower(k)] = v[0]
+	}
+	return m
+}
+
+// recordFields are the Record members an ndjson-generic -field-map entry may
+// target, along with how to assign a decoded JSON value to them.
+var recordFields = map[string]func(rec *Record, v any){
+	"Time":          func(rec *Record, v any) { rec.Ts = toFloat(v) },
+	"Host":          func(rec *Record, v any) { rec.Host = toString(v) },
+	"ClientIP":      func(rec *Record, v any) { rec.RemoteAddr = toString(v) },
+	"Method":        func(rec *Record, v any) { rec.Method = toString(v) },
+	"URI":           func(rec *Record, v any) { rec.URI = toString(v) },
+	"Status":        func(rec *Record, v any) { rec.Status = int(toFloat(v)) },
+	"Size":          func(rec *Record, v any) { rec.Size = int(toFloat(v)) },
+	"Duration":      func(rec *Record, v any) { rec.Duration = toFloat(v) },
+	"Referer":       func(rec *Record, v any) { rec.Referer = toString(v) },
+	"UserAgent":     func(rec *Record, v any) { rec.UserAgent = toString(v) },
+	"MimeType":      func(rec *Record, v any) { rec.ContentType = toString(v) },
+	"Authorization": func(rec *Record, v any) { rec.Authorization = toString(v) },
+}
+
+// ndjsonGenericDecoder decodes one JSON object per line using fieldMap to
+// locate each Record value by dotted JSON path, e.g. "req.remoteIP" ->
+// "ClientIP".
+type ndjsonGenericDecoder struct {
+	fieldMap map[string]string // JSON path -> Record field name
+}
+
+func (d ndjsonGenericDecoder) Decode(line []byte) (Record, bool, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return Record{}, false, err
+	}
+
+	var rec Record
+	for path, field := range d.fieldMap {
+		v, ok := lookupPath(doc, path)
+		if !ok {
+			continue
+		}
+		assign, ok := recordFields[field]
+		if !ok {
+			return Record{}, false, fmt.Errorf("-field-map: unknown target field %q", field)
+		}
+		assign(&rec, v)
+	}
+
+	return rec, true, nil
+}
+
+// parseFieldMap parses a -field-map value like
+// "req.remoteIP=ClientIP,req.host=Host" into path -> Record field name.
+func parseFieldMap(spec string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, field, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("-field-map entry %q must be path=Field", entry)
+		}
+		if _, known := recordFields[field]; !known {
+			return nil, fmt.Errorf("-field-map entry %q: unknown target field %q", entry, field)
+		}
+		m[path] = field
+	}
+	return m, nil
+}
+
+// lookupPath walks a dotted JSON path, e.g. "req.remoteIP", through a
+// decoded JSON object.
+func lookupPath(doc map[string]any, path string) (any, bool) {
+	var v any = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+// clfPattern matches a Common Log Format line:
+// host ident authuser [date] "request" status size
+// The request itself is captured whole since it's sometimes just "-" for
+// aborted or malformed requests, rather than always "method uri proto".
+var clfPattern = regexp.MustCompile(
+	`^(\S+) \S+ \S+ \[([^\]]+)\] "([^"]*)" (\d+) (\S+)`)
+
+// combinedPattern matches an Apache Combined Log Format line: CLF plus a
+// quoted referer and user-agent.
+var combinedPattern = regexp.MustCompile(
+	`^(\S+) \S+ \S+ \[([^\]]+)\] "([^"]*)" (\d+) (\S+) "([^"]*)" "([^"]*)"`)
+
+// apacheTimeParseLayout is the Go time layout for the "[date]" bracket
+// shared by CLF and Combined Log Format, e.g. "10/Oct/2000:13:55:36 -0700".
+const apacheTimeParseLayout = "02/Jan/2006:15:04:05 -0700"
+
+// apacheDecoder decodes CLF and Combined Log Format lines using pattern,
+// which must have the same first five capture groups as clfPattern.
+type apacheDecoder struct {
+	pattern *regexp.Regexp
+}
+
+func (d apacheDecoder) Decode(line []byte) (Record, bool, error) {
+	m := d.pattern.FindSubmatch(line)
+	if m == nil {
+		return Record{}, false, fmt.Errorf("line does not match expected log format: %q", line)
+	}
+
+	t, err := time.Parse(apacheTimeParseLayout, string(m[2]))
+	if err != nil {
+		return Record{}, false, fmt.Errorf("parsing timestamp %q: %w", m[2], err)
+	}
+
+	size, _ := strconv.Atoi(string(m[5]))
+	status, _ := strconv.Atoi(string(m[4]))
+
+	rec := Record{
+		Ts:         float64(t.Unix()),
+		RemoteAddr: string(m[1]),
+		Status:     status,
+		Size:       size,
+	}
+	if fields := strings.Fields(string(m[3])); len(fields) >= 2 {
+		rec.Method = fields[0]
+		rec.URI = fields[1]
+	}
+	if len(m) > 6 {
+		rec.Referer = string(m[6])
+		rec.UserAgent = string(m[7])
+	}
+
+	return rec, true, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestCLFDecoderRoundTripsToGoaccessDefault(t *testing.T) {
+	conf := Config{OutputFormat: "goaccess-default"}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := NewDecoder(Config{InputFormat: "clf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte(`203.0.113.9 - - [10/Oct/2023:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 1234`)
+	rec, ok, err := decoder.Decode(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected line to decode")
+	}
+
+	got, ok := rec.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := "1696946136\t\t203.0.113.9\tGET\t/index.html\t200\t1234\t\t\t\t0"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestCombinedDecoder(t *testing.T) {
+	decoder, err := NewDecoder(Config{InputFormat: "combined"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte(`203.0.113.9 - - [10/Oct/2023:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 1234 "https://example.com/" "curl/8.0"`)
+	rec, ok, err := decoder.Decode(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected line to decode")
+	}
+
+	if rec.Referer != "https://example.com/" || rec.UserAgent != "curl/8.0" {
+		t.Errorf("got referer %q user-agent %q", rec.Referer, rec.UserAgent)
+	}
+	if rec.RemoteAddr != "203.0.113.9" || rec.Method != "GET" || rec.URI != "/index.html" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestCLFDecoderRejectsUnmatchedLine(t *testing.T) {
+	decoder, err := NewDecoder(Config{InputFormat: "clf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := decoder.Decode([]byte("not a clf line")); err == nil {
+		t.Fatal("expected an error for a malformed line")
+	}
+}
+
+func TestNDJSONGenericDecoder(t *testing.T) {
+	decoder, err := NewDecoder(Config{
+		InputFormat: "ndjson-generic",
+		FieldMap:    "req.remoteIP=ClientIP,req.host=Host,req.method=Method,status=Status",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := []byte(`{"req":{"remoteIP":"198.51.100.5:1234","host":"example.com","method":"POST"},"status":201}`)
+	rec, ok, err := decoder.Decode(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected line to decode")
+	}
+
+	if rec.RemoteAddr != "198.51.100.5:1234" || rec.Host != "example.com" || rec.Method != "POST" || rec.Status != 201 {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestNDJSONGenericDecoderUnknownField(t *testing.T) {
+	if _, err := NewDecoder(Config{
+		InputFormat: "ndjson-generic",
+		FieldMap:    "req.remoteIP=NotAField",
+	}); err == nil {
+		t.Fatal("expected an error for an unknown target field")
+	}
+}
+
+func TestNewDecoderUnknownInputFormat(t *testing.T) {
+	if _, err := NewDecoder(Config{InputFormat: "bogus"}); err == nil {
+		t.Fatal("expected an error for an unknown -input-format")
+	}
+}
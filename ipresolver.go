@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// defaultClientIPHeaders is the precedence order used when -client-ip-headers
+// is not set: prefer the standardised Forwarded header, then the common
+// de-facto ones.
+var defaultClientIPHeaders = []string{"forwarded", "x-forwarded-for", "x-real-ip", "true-client-ip"}
+
+// ClientIPResolver determines the real client IP for a request, honouring
+// only proxy headers added by proxies we trust. This replaces blindly
+// trusting the first X-Forwarded-For token, which any client can spoof.
+type ClientIPResolver struct {
+	trustedProxies []*net.IPNet
+	trustAll       bool
+	headers        []string
+}
+
+// NewClientIPResolver builds a resolver from -trusted-proxies CIDRs (e.g.
+// "10.0.0.0/8,fd00::/8"), the -trust-all-proxies shortcut, and the
+// precedence order of proxy headers to consult. An empty headers list uses
+// defaultClientIPHeaders.
+func NewClientIPResolver(trustedProxyCIDRs []string, trustAll bool, headers []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{trustAll: trustAll}
+
+	for _, cidr := range trustedProxyCIDRs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -trusted-proxies %q: %w", cidr, err)
+		}
+		r.trustedProxies = append(r.trustedProxies, n)
+	}
+
+	if len(headers) == 0 {
+		headers = defaultClientIPHeaders
+	}
+	for _, h := range headers {
+		r.headers = append(r.headers, strings.ToLower(strings.TrimSpace(h)))
+	}
+
+	return r, nil
+}
+
+// ClientIP is the result of resolving the real client IP for a request.
+type ClientIP struct {
+	IP         string
+	ProxyChain []string // trusted hops walked to reach IP, nearest proxy first
+}
+
+// Resolve returns the real client IP for a request, given its immediate
+// RemoteAddr and its normalized request headers. If RemoteAddr's peer is not
+// a trusted proxy, no header is trusted and RemoteAddr's host is returned
+// as-is. Otherwise the configured headers are tried in precedence order,
+// walking each one's hop list from the most recent entry backwards and
+// skipping trusted hops, until an untrusted (i.e. real client) IP is found.
+func (r *ClientIPResolver) Resolve(remoteAddr string, headers map[string]string) ClientIP {
+	remoteHost := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteHost = host
+	}
+
+	if !r.isTrusted(remoteHost) {
+		return ClientIP{IP: remoteHost}
+	}
+
+	for _, name := range r.headers {
+		value := headers[name]
+		if value == "" {
+			continue
+		}
+
+		var hops []string
+		if name == "forwarded" {
+			hops = parseForwarded(value)
+		} else {
+			hops = splitAndTrim(value)
+		}
+		if len(hops) == 0 {
+			continue
+		}
+
+		ip, chain, found := r.walkHops(hops)
+		if !found {
+			// Every hop, including the client-supplied one, is trusted: there
+			// is no untrusted entry to treat as the real client.
+			return ClientIP{IP: remoteHost, ProxyChain: chain}
+		}
+		return ClientIP{IP: ip, ProxyChain: chain}
+	}
+
+	return ClientIP{IP: remoteHost}
+}
+
+// walkHops walks a list of IPs ordered oldest (original client) to newest
+// (closest proxy) from the end, skipping trusted proxies, and returns the
+// first untrusted IP found plus the trusted hops skipped to reach it. found
+// is false if every hop turned out to be trusted.
+func (r *ClientIPResolver) walkHops(hops []string) (ip string, chain []string, found bool) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		if r.isTrusted(hop) {
+			chain = append(chain, hop)
+			continue
+		}
+		return hop, chain, true
+	}
+	return "", chain, false
+}
+
+func (r *ClientIPResolver) isTrusted(ip string) bool {
+	if r.trustAll {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range r.trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitAndTrim(value string) []string {
+	parts := strings.Split(value, ",")
+	hops := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			hops = append(hops, p)
+		}
+	}
+	return hops
+}
+
+// parseForwarded extracts the "for=" IPs from an RFC 7239 Forwarded header
+// value, in the order they appear (oldest hop first, same convention as
+// X-Forwarded-For). It accepts quoted values, IPv6 literals in brackets with
+// an optional port (e.g. `for="[2001:db8::1]:4711"`), and obfuscated
+// identifiers, which are returned verbatim since they can't be checked
+// against a trusted CIDR.
+func parseForwarded(value string) []string {
+	var hops []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(k), "for") {
+				continue
+			}
+			v = strings.Trim(strings.TrimSpace(v), `"`)
+			hops = append(hops, stripForwardedPort(v))
+		}
+	}
+	return hops
+}
+
+// stripForwardedPort removes a trailing ":port" from a Forwarded "for="
+// value, handling bracketed IPv6 literals like "[2001:db8::1]:4711".
+func stripForwardedPort(v string) string {
+	if strings.HasPrefix(v, "[") {
+		if end := strings.IndexByte(v, ']'); end != -1 {
+			return v[1:end]
+		}
+		return v
+	}
+	// A bare IPv6 literal has more than one colon; only a trailing
+	// ":port" on an IPv4 literal should be stripped.
+	if host, port, err := net.SplitHostPort(v); err == nil {
+		if _, err := strconv.Atoi(port); err == nil {
+			return host
+		}
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientIPResolverUntrustedPeerIgnoresHeaders(t *testing.T) {
+	r, err := NewClientIPResolver(nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("203.0.113.9:1234", map[string]string{
+		"x-forwarded-for": "1.2.3.4",
+	})
+
+	want := ClientIP{IP: "203.0.113.9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverXForwardedFor(t *testing.T) {
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("10.0.0.1:1234", map[string]string{
+		"x-forwarded-for": "198.51.100.7, 203.0.113.9, 10.0.0.2",
+	})
+
+	want := ClientIP{IP: "203.0.113.9", ProxyChain: []string{"10.0.0.2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverForwardedIPv6(t *testing.T) {
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("10.0.0.1:1234", map[string]string{
+		"forwarded": `for="[2001:db8::1]:4711", for=10.0.0.2`,
+	})
+
+	want := ClientIP{IP: "2001:db8::1", ProxyChain: []string{"10.0.0.2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverForwardedTakesPrecedenceOverXFF(t *testing.T) {
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("10.0.0.1:1234", map[string]string{
+		"forwarded":       `for=203.0.113.9, for=10.0.0.2`,
+		"x-forwarded-for": "198.51.100.7, 10.0.0.2",
+	})
+
+	want := ClientIP{IP: "203.0.113.9", ProxyChain: []string{"10.0.0.2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverSpoofedLeadingEntryIgnored(t *testing.T) {
+	// A client can prepend arbitrary entries to X-Forwarded-For; only the
+	// hop nearest our trusted proxy should ever be believed.
+	r, err := NewClientIPResolver([]string{"192.0.2.0/24"}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("192.0.2.2:1234", map[string]string{
+		"x-forwarded-for": "1.2.3.4, 203.0.113.9, 192.0.2.2",
+	})
+
+	want := ClientIP{IP: "203.0.113.9", ProxyChain: []string{"192.0.2.2"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverTrustAllProxies(t *testing.T) {
+	r, err := NewClientIPResolver(nil, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Resolve("203.0.113.9:1234", map[string]string{
+		"x-forwarded-for": "198.51.100.7, 203.0.113.200",
+	})
+
+	want := ClientIP{IP: "203.0.113.9", ProxyChain: []string{"203.0.113.200", "198.51.100.7"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestClientIPResolverInvalidCIDR(t *testing.T) {
+	if _, err := NewClientIPResolver([]string{"not-a-cidr"}, false, nil); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+}
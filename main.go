@@ -2,155 +2,253 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
-	"encoding/json"
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
-	"mime"
-	"net"
 	"os"
-	"strconv"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
+	"text/template"
 )
 
-type CaddyLog struct {
-	Ts      float64 `json:"ts"`
-	Logger  string  `json:"logger"`
-	Msg     string  `json:"msg"`
-	Request struct {
-		RemoteAddr        string              `json:"remote_addr"`
-		Proto             string              `json:"proto"`
-		Method            string              `json:"method"`
-		Host              string              `json:"host"`
-		URI               string              `json:"uri"`
-		Headers           map[string][]string `json:"headers"`
-		normalizedHeaders map[string]string
-		TLS               struct {
-			Resumed     bool   `json:"resumed"`
-			Version     int    `json:"version"`
-			CipherSuite int    `json:"cipher_suite"`
-			Proto       string `json:"proto"`
-			ProtoMutual bool   `json:"proto_mutual"`
-			ServerName  string `json:"server_name"`
-		} `json:"tls"`
-	} `json:"request"`
-	Duration              float64             `json:"duration"`
-	Size                  int                 `json:"size"`
-	Status                int                 `json:"status"`
-	RespHeaders           map[string][]string `json:"resp_headers"`
-	normalizedRespHeaders map[string]string
+// outputPreset pairs the text/template used to render log lines with the
+// goaccess log-format/date-format/time-format triple that decodes them, and
+// the Go time layout used to produce the {{.Time}} placeholder.
+type outputPreset struct {
+	tmpl       *template.Template
+	logFormat  string
+	dateFormat string
+	timeFormat string
+	timeLayout string
 }
 
-func (l *CaddyLog) Format(conf Config) (string, bool) {
-	// %x  A date and time field matching the time-format and date-format variables. This is used when a timestamp is given instead of the date and time being in two separate variables.
-	// %t  time field matching the time-format variable.
-	// %d  date field matching the date-format variable.
-	// %v  The server name according to the canonical name setting (Server Blocks or Virtual Host).
-	// %e  This is the userid of the person requesting the document as determined by HTTP authentication.
-	// %C  The cache status of the object the server served.
-	// %h  host (the client IP address, either IPv4 or IPv6)
-	// %r  The request line from the client. This requires specific delimiters around the request (single quotes, double quotes, etc) to be parsable. Otherwise, use a combination of special format specifiers such as %m, %U, %q and %H to parse individual fields. Note: Use either %r to get the full request OR %m, %U, %q and %H to form your request, do not use both.
-	// %m  The request method.
-	// %U  The URL path requested. Note: If the query string is in %U, there is no need to use %q. However, if the URL path, does not include any query string, you may use %q and the query string will be appended to the request.
-	// %q The query string.
-	// %H The request protocol.
-	// %s The status code that the server sends back to the client.
-	// %b The size of the object returned to the client.
-	// %R The "Referer" HTTP request header.
-	// %u The user-agent HTTP request header.
-	// %K The TLS encryption settings chosen for the connection. (In Apache LogFormat: %{SSL_PROTOCOL}x).
-	// %k The TLS encryption settings chosen for the connection. (In Apache LogFormat: %{SSL_CIPHER}x).
-	// %M The MIME-type of the requested resource. (In Apache LogFormat: %{Content-Type}o)
-	// %D The time taken to serve the request, in microseconds.
-	// %T The time taken to serve the request, in seconds with milliseconds resolution.
-	// %L The time taken to serve the request, in milliseconds as a decimal number.
-	// %^Ignore this field.
-	// %~ Move forward through the log string until a non-space (!isspace) char is found.
-	// ~h The host (the client IP address, either IPv4 or IPv6) in a X-Forwarded-For (XFF) field.
-
-	//%v:%^ %h %^[%d:%t %^] "%r" %s %b "%R" "%u"
-
-	if conf.IncludeHosts != "" && !strings.HasPrefix(l.Request.Host, conf.IncludeHosts) {
-		return "", false
-	}
-
-	if conf.ExcludeURLs != "" && strings.HasPrefix(l.Request.URI, conf.ExcludeURLs) {
-		return "", false
-	}
-
-	l.Request.normalizedHeaders = normalizeHeaders(l.Request.Headers)
-	l.normalizedRespHeaders = normalizeHeaders(l.RespHeaders)
-	remote_host, _, _ := net.SplitHostPort(l.Request.RemoteAddr)
-	if xff := l.Request.normalizedHeaders["x-forwarded-for"]; xff != "" {
-		parts := strings.SplitN(xff, ",", 2)
-		remote_host = strings.TrimSpace(parts[0])
-	}
-	if conf.ExcludeClients != "" && strings.HasPrefix(remote_host, conf.ExcludeClients) {
-		return "", false
-	}
-
-	contentType, _, _ := mime.ParseMediaType(l.normalizedRespHeaders["content-type"])
-
-	// TS VHost ClientIP Method URI Status Size Referer UserAgent MimeType Duration
-	// %x %v    %h       %m     %U  %s     %b   %R      %u        %M       %T
-	// %x\t%v\t%h\t%m\t%U\t%s\t%b\t%R\t%u\t%M\t%T
-	fields := []string{
-		strconv.Itoa(int(l.Ts)),                      // %x
-		l.Request.Host,                               // %v
-		remote_host,                                  // %h
-		l.Request.Method,                             // %m
-		l.Request.URI,                                // %U
-		strconv.Itoa(l.Status),                       // %s
-		strconv.Itoa(l.Size),                         // %b
-		l.Request.normalizedHeaders["referer"],       // %R
-		l.Request.normalizedHeaders["user-agent"],    // %u
-		contentType,                                  // %M
-		strconv.FormatFloat(l.Duration, 'f', -1, 64), // %T
-	}
-
-	return strings.Join(fields, "\t"), true
+// apacheTimeLayout is the Go time layout matching goaccess' "%d/%b/%Y" date
+// format and "%H:%M:%S" time format, as used by the apache-style presets.
+const apacheTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// namedOutputFormats are the built-in -output-format presets.
+var namedOutputFormats = map[string]outputPreset{
+	"goaccess-default": {
+		logFormat:  `%x\t%v\t%h\t%m\t%U\t%s\t%b\t%R\t%u\t%M\t%T`,
+		dateFormat: `%s`,
+		timeFormat: `%s`,
+		timeLayout: "",
+	},
+	"clf": {
+		logFormat:  `%h %^[%d:%t %^] "%r" %s %b`,
+		dateFormat: `%d/%b/%Y`,
+		timeFormat: `%H:%M:%S`,
+		timeLayout: apacheTimeLayout,
+	},
+	"combined": {
+		logFormat:  `%h %^[%d:%t %^] "%r" %s %b "%R" "%u"`,
+		dateFormat: `%d/%b/%Y`,
+		timeFormat: `%H:%M:%S`,
+		timeLayout: apacheTimeLayout,
+	},
+	"combined-vhost": {
+		logFormat:  `%v:%^ %h %^[%d:%t %^] "%r" %s %b "%R" "%u"`,
+		dateFormat: `%d/%b/%Y`,
+		timeFormat: `%H:%M:%S`,
+		timeLayout: apacheTimeLayout,
+	},
 }
 
-func normalizeHeaders(h map[string][]string) map[string]string {
-	m := map[string]string{}
-	for k, v := range h {
-		if len(v) == 0 {
-			continue
+// namedOutputTemplates holds the text/template body for each entry in
+// namedOutputFormats, kept separate so the map literal above stays readable.
+var namedOutputTemplates = map[string]string{
+	"goaccess-default": "{{.Time}}\t{{.Host}}\t{{.ClientIP}}\t{{.Method}}\t{{.URI}}\t{{.Status}}\t{{.Size}}\t{{.Referer}}\t{{.UserAgent}}\t{{.MimeType}}\t{{.Duration}}",
+	"clf":              `{{.ClientIP}} - {{.User}} [{{.Time}}] "{{.Method}} {{.URI}} HTTP/1.1" {{.Status}} {{.Size}}`,
+	"combined":         `{{.ClientIP}} - {{.User}} [{{.Time}}] "{{.Method}} {{.URI}} HTTP/1.1" {{.Status}} {{.Size}} "{{.Referer}}" "{{.UserAgent}}"`,
+	"combined-vhost":   `{{.Host}} {{.ClientIP}} - {{.User}} [{{.Time}}] "{{.Method}} {{.URI}} HTTP/1.1" {{.Status}} {{.Size}} "{{.Referer}}" "{{.UserAgent}}"`,
+}
+
+// fieldLogFormatCodes maps an outputFields placeholder name to the goaccess
+// log-format specifier it corresponds to, used to derive a log-format string
+// for custom -output-format templates.
+var fieldLogFormatCodes = map[string]string{
+	"Time":       "%x",
+	"Host":       "%v",
+	"ClientIP":   "%h",
+	"Method":     "%m",
+	"URI":        "%U",
+	"Status":     "%s",
+	"Size":       "%b",
+	"Referer":    "%R",
+	"UserAgent":  "%u",
+	"MimeType":   "%M",
+	"Duration":   "%T",
+	"TLSVersion": "%K",
+	"TLSCipher":  "%k",
+	"User":       "%e",
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// logFormatForTemplate translates a custom output template into the
+// goaccess log-format string that parses its output, by replacing each
+// recognised {{.Field}} placeholder with its % specifier and leaving the
+// surrounding literal text untouched.
+func logFormatForTemplate(tmplText string) string {
+	return templatePlaceholder.ReplaceAllStringFunc(tmplText, func(m string) string {
+		name := templatePlaceholder.FindStringSubmatch(m)[1]
+		if code, ok := fieldLogFormatCodes[name]; ok {
+			return code
 		}
-		m[strings.ToLower(k)] = v[0]
+		return m
+	})
+}
+
+// resolveOutputFormat turns a -output-format value, either a named preset
+// or a custom text/template string, into a ready-to-use outputPreset.
+func resolveOutputFormat(spec string) (outputPreset, error) {
+	if spec == "" {
+		spec = "goaccess-default"
+	}
+
+	tmplText, ok := namedOutputTemplates[spec]
+	preset := namedOutputFormats[spec]
+	if !ok {
+		tmplText = spec
+		preset = outputPreset{
+			logFormat:  logFormatForTemplate(spec),
+			dateFormat: `%s`,
+			timeFormat: `%s`,
+			timeLayout: "",
+		}
+	}
+
+	tmpl, err := template.New("output-format").Parse(tmplText)
+	if err != nil {
+		return outputPreset{}, fmt.Errorf("parsing -output-format %q: %w", spec, err)
 	}
-	return m
+	preset.tmpl = tmpl
+
+	return preset, nil
 }
 
 type Config struct {
-	IncludeHosts   string
-	ExcludeClients string
-	ExcludeURLs    string
+	IncludeHosts    string
+	ExcludeClients  string
+	ExcludeURLs     string
+	OutputFormat    string
+	TrustedProxies  []string
+	TrustAllProxies bool
+	ClientIPHeaders []string
+
+	Follow bool
+
+	OutputFile       string
+	OutputMaxSize    int
+	OutputMaxAge     int
+	OutputMaxBackups int
+	OutputCompress   bool
+	OutputLocalTime  bool
+
+	InputFormat string
+	FieldMap    string
+
+	preset   *outputPreset
+	resolver *ClientIPResolver
+}
+
+// outputPreset lazily resolves and caches Config.OutputFormat. Config is
+// expected to be prepared once via Config.resolve before use.
+func (c Config) outputPreset() outputPreset {
+	if c.preset == nil {
+		panic("Config.resolve was not called")
+	}
+	return *c.preset
+}
+
+// clientIPResolver returns the ClientIPResolver built from Config.resolve.
+func (c Config) clientIPResolver() *ClientIPResolver {
+	if c.resolver == nil {
+		panic("Config.resolve was not called")
+	}
+	return c.resolver
 }
 
-const logFormat = `%x\t%v\t%h\t%m\t%U\t%s\t%b\t%R\t%u\t%M\t%T`
+// resolve parses OutputFormat and the client IP resolver settings and must
+// be called once before the Config is used to format any log lines.
+func (c *Config) resolve() error {
+	preset, err := resolveOutputFormat(c.OutputFormat)
+	if err != nil {
+		return err
+	}
+	c.preset = &preset
+
+	resolver, err := NewClientIPResolver(c.TrustedProxies, c.TrustAllProxies, c.ClientIPHeaders)
+	if err != nil {
+		return err
+	}
+	c.resolver = resolver
+
+	return nil
+}
 
 func main() {
-	printLogFormat := flag.Bool("print-log-format", false, "Print the log-format to use in goaccess")
+	printLogFormat := flag.Bool("print-log-format", false, "Print the goaccess log-format/date-format/time-format to use for the active -output-format")
 	includeHosts := flag.String("include-hosts", "", "Only include hosts having this prefix")
 	excludeClients := flag.String("exclude-client", "", "Ignores clients having this prefix")
 	excludeURLs := flag.String("exclude-urls", "", "Ignores URLs having this prefix")
+	outputFormat := flag.String("output-format", "goaccess-default", "Output format: a named preset (goaccess-default, clf, combined, combined-vhost) or a custom text/template string")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated CIDRs of proxies allowed to set client IP headers, e.g. 10.0.0.0/8,fd00::/8")
+	trustAllProxies := flag.Bool("trust-all-proxies", false, "Trust client IP headers from any peer (shortcut for -trusted-proxies 0.0.0.0/0,::/0)")
+	clientIPHeaders := flag.String("client-ip-headers", strings.Join(defaultClientIPHeaders, ","), "Comma-separated precedence order of headers to resolve the client IP from")
+	follow := flag.Bool("follow", false, "Don't exit at EOF: keep watching each file for new lines, following Caddy's log rotation")
+	flag.BoolVar(follow, "tail", false, "Alias for -follow")
+	outputFile := flag.String("output-file", "", "Write output to this file (rotated) instead of stdout")
+	outputMaxSize := flag.Int("output-max-size", 100, "Max size in MiB of the output file before it gets rotated")
+	outputMaxAge := flag.Int("output-max-age", 0, "Max age in days to retain rotated output files (0 keeps them forever)")
+	outputMaxBackups := flag.Int("output-max-backups", 0, "Max number of rotated output files to retain (0 keeps them all)")
+	outputCompress := flag.Bool("output-compress", false, "Gzip rotated output files")
+	outputLocalTime := flag.Bool("output-local-time", false, "Use the local time zone for rotated output file timestamps instead of UTC")
+	inputFormat := flag.String("input-format", "caddy-json", "Input format: caddy-json, ndjson-generic, clf, or combined")
+	fieldMap := flag.String("field-map", "", "For -input-format ndjson-generic: comma-separated path=Field mappings, e.g. req.remoteIP=ClientIP,req.host=Host")
 	flag.Parse()
 
+	conf := Config{
+		IncludeHosts:     *includeHosts,
+		ExcludeClients:   *excludeClients,
+		ExcludeURLs:      *excludeURLs,
+		OutputFormat:     *outputFormat,
+		TrustedProxies:   splitAndTrim(*trustedProxies),
+		TrustAllProxies:  *trustAllProxies,
+		ClientIPHeaders:  splitAndTrim(*clientIPHeaders),
+		Follow:           *follow,
+		OutputFile:       *outputFile,
+		OutputMaxSize:    *outputMaxSize,
+		OutputMaxAge:     *outputMaxAge,
+		OutputMaxBackups: *outputMaxBackups,
+		OutputCompress:   *outputCompress,
+		OutputLocalTime:  *outputLocalTime,
+		InputFormat:      *inputFormat,
+		FieldMap:         *fieldMap,
+	}
+	if err := conf.resolve(); err != nil {
+		fmt.Printf("Invalid -output-format: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *printLogFormat {
-		fmt.Println(logFormat)
+		preset := conf.outputPreset()
+		fmt.Printf("log-format %s\n", preset.logFormat)
+		fmt.Printf("date-format %s\n", preset.dateFormat)
+		fmt.Printf("time-format %s\n", preset.timeFormat)
 		os.Exit(0)
 	}
 
-	conf := Config{
-		IncludeHosts:   *includeHosts,
-		ExcludeClients: *excludeClients,
-		ExcludeURLs:    *excludeURLs,
+	out := newOutputWriter(conf)
+	if closer, ok := out.(io.Closer); ok {
+		defer closer.Close()
 	}
 
 	for _, file := range flag.Args() {
-		err := processFile(file, conf)
+		err := processFile(file, conf, out)
 		if err != nil {
 			fmt.Printf("Could not process %s: %v\n", file, err)
 			os.Exit(1)
@@ -158,32 +256,74 @@ func main() {
 	}
 }
 
-func processFile(file string, conf Config) error {
-	f, err := os.Open(file)
+func processFile(file string, conf Config, out io.Writer) error {
+	decoder, err := NewDecoder(conf)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	var r io.Reader = bufio.NewReader(f)
+	var (
+		r      io.Reader
+		closer io.Closer
+		tailer *Tailer
+	)
 
-	if strings.HasSuffix(file, ".gz") {
-		r, err = gzip.NewReader(f)
+	if conf.Follow {
+		if isCompressed(file) {
+			return fmt.Errorf("-follow does not support compressed files")
+		}
+		t, err := NewTailer(file)
 		if err != nil {
 			return err
 		}
+		tailer, r, closer = t, t, t
+	} else {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		closer = f
+
+		r, err = decompress(file, bufio.NewReader(f))
+		if err != nil {
+			return err
+		}
+	}
+	defer closer.Close()
+
+	if tailer != nil {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		defer signal.Stop(sighup)
+		go func() {
+			for range sighup {
+				tailer.Reopen()
+				if err := reopenOutput(out); err != nil {
+					fmt.Fprintf(os.Stderr, "reopening output: %v\n", err)
+				}
+			}
+		}()
 	}
 
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+
 	total, included, excluded := 0, 0, 0
-	dec := json.NewDecoder(r)
-	for dec.More() {
-		l := CaddyLog{}
-		err := dec.Decode(&l)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		rec, ok, err := decoder.Decode(line)
 		if err != nil {
 			return err
 		}
-		if line, ok := l.Format(conf); ok {
-			fmt.Println(line)
+		if !ok {
+			continue
+		}
+		if formatted, ok := rec.Format(conf); ok {
+			fmt.Fprintln(out, formatted)
 			included++
 		} else {
 			excluded++
@@ -193,5 +333,5 @@ func processFile(file string, conf Config) error {
 			fmt.Fprintf(os.Stderr, "processed %d (%d included, %d excluded)\n", total, included, excluded)
 		}
 	}
-	return nil
+	return scanner.Err()
 }
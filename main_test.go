@@ -0,0 +1,121 @@
+package main
+
+import "testing"
+
+func sampleLog() Record {
+	return Record{
+		Ts:          1700000000,
+		Status:      200,
+		Size:        1234,
+		RemoteAddr:  "203.0.113.9:54321",
+		Method:      "GET",
+		Host:        "example.com",
+		URI:         "/index.html",
+		Duration:    0.001234,
+		Referer:     "https://example.com/",
+		UserAgent:   "curl/8.0",
+		ContentType: "text/html",
+	}
+}
+
+func TestFormatGoaccessDefault(t *testing.T) {
+	l := sampleLog()
+	conf := Config{OutputFormat: "goaccess-default"}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := l.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := "1700000000\texample.com\t203.0.113.9\tGET\t/index.html\t200\t1234\thttps://example.com/\tcurl/8.0\ttext/html\t0.001234"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatCLF(t *testing.T) {
+	l := sampleLog()
+	conf := Config{OutputFormat: "clf"}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := l.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := `203.0.113.9 - - [14/Nov/2023:22:13:20 +0000] "GET /index.html HTTP/1.1" 200 1234`
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatCombined(t *testing.T) {
+	l := sampleLog()
+	conf := Config{OutputFormat: "combined"}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := l.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := `203.0.113.9 - - [14/Nov/2023:22:13:20 +0000] "GET /index.html HTTP/1.1" 200 1234 "https://example.com/" "curl/8.0"`
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatCombinedVhost(t *testing.T) {
+	l := sampleLog()
+	conf := Config{OutputFormat: "combined-vhost"}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := l.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := `example.com 203.0.113.9 - - [14/Nov/2023:22:13:20 +0000] "GET /index.html HTTP/1.1" 200 1234 "https://example.com/" "curl/8.0"`
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestFormatCustomTemplate(t *testing.T) {
+	l := sampleLog()
+	conf := Config{OutputFormat: `{{.Status}} {{.Method}} {{.URI}}`}
+	if err := conf.resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := l.Format(conf)
+	if !ok {
+		t.Fatal("expected line to be included")
+	}
+
+	want := "200 GET /index.html"
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	preset := conf.outputPreset()
+	if preset.logFormat != "%s %m %U" {
+		t.Errorf("got log-format %q, want %q", preset.logFormat, "%s %m %U")
+	}
+}
+
+func TestResolveOutputFormatInvalidTemplate(t *testing.T) {
+	conf := Config{OutputFormat: `{{.Status`}
+	if err := conf.resolve(); err == nil {
+		t.Fatal("expected an error for an invalid template")
+	}
+}
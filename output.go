@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// newOutputWriter builds the writer log lines are printed to. With no
+// -output-file it is stdout, unchanged from before; otherwise it is a
+// lumberjack logger that rotates the file per -output-max-size/-age/-backups.
+func newOutputWriter(conf Config) io.Writer {
+	if conf.OutputFile == "" {
+		return os.Stdout
+	}
+
+	return &lumberjack.Logger{
+		Filename:   conf.OutputFile,
+		MaxSize:    conf.OutputMaxSize,
+		MaxAge:     conf.OutputMaxAge,
+		MaxBackups: conf.OutputMaxBackups,
+		Compress:   conf.OutputCompress,
+		LocalTime:  conf.OutputLocalTime,
+	}
+}
+
+// reopenOutput forces a rotated output file to be closed and reopened, e.g.
+// in response to SIGHUP. Writers that don't support it (plain stdout) are
+// left alone.
+func reopenOutput(w io.Writer) error {
+	if l, ok := w.(*lumberjack.Logger); ok {
+		return l.Rotate()
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is the neutral representation every input decoder populates.
+// Format renders it through the active -output-format template, so the
+// same output presets work regardless of which log schema was decoded.
+type Record struct {
+	Ts            float64
+	Host          string
+	RemoteAddr    string
+	Method        string
+	URI           string
+	Status        int
+	Size          int
+	Duration      float64
+	Referer       string
+	UserAgent     string
+	ContentType   string
+	Authorization string
+	TLSVersion    int
+	TLSCipher     int
+
+	// proxyHeaders holds the raw forwarded/x-forwarded-for/x-real-ip/
+	// true-client-ip headers for decoders that have them (currently only
+	// caddy-json), so ClientIPResolver can walk trusted proxy chains.
+	proxyHeaders map[string]string
+}
+
+// outputFields is the set of values a Config.OutputFormat template can
+// reference via named placeholders, e.g. {{.ClientIP}}.
+type outputFields struct {
+	Time       string
+	Host       string
+	ClientIP   string
+	Method     string
+	URI        string
+	Status     int
+	Size       int
+	Referer    string
+	UserAgent  string
+	MimeType   string
+	Duration   float64
+	TLSVersion string
+	TLSCipher  string
+	User       string
+	ProxyChain string
+}
+
+func (r *Record) Format(conf Config) (string, bool) {
+	// %x  A date and time field matching the time-format and date-format variables. This is used when a timestamp is given instead of the date and time being in two separate variables.
+	// %t  time field matching the time-format variable.
+	// %d  date field matching the date-format variable.
+	// %v  The server name according to the canonical name setting (Server Blocks or Virtual Host).
+	// %e  This is the userid of the person requesting the document as determined by HTTP authentication.
+	// %C  The cache status of the object the server served.
+	// %h  host (the client IP address, either IPv4 or IPv6)
+	// %r  The request line from the client. This requires specific delimiters around the request (single quotes, double quotes, etc) to be parsable. Otherwise, use a combination of special format specifiers such as %m, %U, %q and %H to parse individual fields. Note: Use either %r to get the full request OR %m, %U, %q and %H to form your request, do not use both.
+	// %m  The request method.
+	// %U  The URL path requested. Note: If the query string is in %U, there is no need to use %q. However, if the URL path, does not include any query string, you may use %q and the query string will be appended to the request.
+	// %q The query string.
+	// %H The request protocol.
+	// %s The status code that the server sends back to the client.
+	// %b The size of the object returned to the client.
+	// %R The "Referer" HTTP request header.
+	// %u The user-agent HTTP request header.
+	// %K The TLS encryption settings chosen for the connection. (In Apache LogFormat: %{SSL_PROTOCOL}x).
+	// %k The TLS encryption settings chosen for the connection. (In Apache LogFormat: %{SSL_CIPHER}x).
+	// %M The MIME-type of the requested resource. (In Apache LogFormat: %{Content-Type}o)
+	// %D The time taken to serve the request, in microseconds.
+	// %T The time taken to serve the request, in seconds with milliseconds resolution.
+	// %L The time taken to serve the request, in milliseconds as a decimal number.
+	// %^Ignore this field.
+	// %~ Move forward through the log string until a non-space (!isspace) char is found.
+	// ~h The host (the client IP address, either IPv4 or IPv6) in a X-Forwarded-For (XFF) field.
+
+	if conf.IncludeHosts != "" && !strings.HasPrefix(r.Host, conf.IncludeHosts) {
+		return "", false
+	}
+
+	if conf.ExcludeURLs != "" && strings.HasPrefix(r.URI, conf.ExcludeURLs) {
+		return "", false
+	}
+
+	clientIP := conf.clientIPResolver().Resolve(r.RemoteAddr, r.proxyHeaders)
+	if conf.ExcludeClients != "" && strings.HasPrefix(clientIP.IP, conf.ExcludeClients) {
+		return "", false
+	}
+
+	preset := conf.outputPreset()
+
+	user := basicAuthUser(r.Authorization)
+	if user == "" {
+		user = "-"
+	}
+
+	fields := outputFields{
+		Time:       formatTime(r.Ts, preset.timeLayout),
+		Host:       r.Host,
+		ClientIP:   clientIP.IP,
+		Method:     r.Method,
+		URI:        r.URI,
+		Status:     r.Status,
+		Size:       r.Size,
+		Referer:    r.Referer,
+		UserAgent:  r.UserAgent,
+		MimeType:   r.ContentType,
+		Duration:   r.Duration,
+		TLSVersion: tlsVersionName(r.TLSVersion),
+		TLSCipher:  tlsCipherName(r.TLSCipher),
+		User:       user,
+		ProxyChain: strings.Join(clientIP.ProxyChain, ","),
+	}
+
+	var buf strings.Builder
+	if err := preset.tmpl.Execute(&buf, fields); err != nil {
+		return "", false
+	}
+
+	return buf.String(), true
+}
+
+// formatTime renders a unix timestamp (seconds since epoch) using layout.
+// An empty layout keeps the original behaviour of emitting the integer
+// unix timestamp, which pairs with the "%s" goaccess date-format/time-format.
+func formatTime(ts float64, layout string) string {
+	if layout == "" {
+		return strconv.Itoa(int(ts))
+	}
+	return time.Unix(int64(ts), 0).UTC().Format(layout)
+}
+
+func tlsVersionName(version int) string {
+	if version == 0 {
+		return ""
+	}
+	return tls.VersionName(uint16(version))
+}
+
+func tlsCipherName(suite int) string {
+	if suite == 0 {
+		return ""
+	}
+	return tls.CipherSuiteName(uint16(suite))
+}
+
+// basicAuthUser extracts the username from a "Basic" Authorization header,
+// returning "" if the header is absent or malformed.
+func basicAuthUser(authorization string) string {
+	const prefix = "Basic "
+	if !strings.HasPrefix(authorization, prefix) {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(authorization[len(prefix):])
+	if err != nil {
+		return ""
+	}
+	user, _, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return ""
+	}
+	return user
+}
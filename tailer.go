@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// pollInterval is how often a Tailer checks for new data and for log
+// rotation once it has caught up to the end of the file.
+const pollInterval = 1 * time.Second
+
+// Tailer is an io.Reader over a file that, once it reaches EOF, blocks and
+// waits for more data instead of returning io.EOF. It follows Caddy's own
+// log rotation: if the file at path is replaced or truncated, Tailer
+// transparently reopens it by name.
+type Tailer struct {
+	path    string
+	f       *os.File
+	info    os.FileInfo
+	reopen  chan struct{}
+	closing chan struct{}
+}
+
+// NewTailer opens path and seeks to its end, ready to stream lines appended
+// to it from this point on.
+func NewTailer(path string) (*Tailer, error) {
+	t := &Tailer{
+		path:    path,
+		reopen:  make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	if err := t.openAt(io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Tailer) openAt(whence int) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if whence == io.SeekEnd {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if t.f != nil {
+		t.f.Close()
+	}
+	t.f = f
+	t.info = info
+	return nil
+}
+
+// Reopen forces the tailer to close and reopen its file by name, discarding
+// any buffered read position. It is safe to call from a signal handler.
+func (t *Tailer) Reopen() {
+	select {
+	case t.reopen <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the tailer and releases its underlying file.
+func (t *Tailer) Close() error {
+	close(t.closing)
+	return t.f.Close()
+}
+
+// Read implements io.Reader, blocking at EOF until new data is appended, the
+// file is rotated, or the Tailer is closed.
+func (t *Tailer) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		select {
+		case <-t.closing:
+			return 0, io.EOF
+		case <-t.reopen:
+			if err := t.openAt(io.SeekStart); err != nil {
+				return 0, err
+			}
+		case <-time.After(pollInterval):
+			if rotated, err := t.checkRotated(); err != nil {
+				return 0, err
+			} else if rotated {
+				continue
+			}
+		}
+	}
+}
+
+// checkRotated detects whether the file at t.path now refers to a different
+// inode (rotated out from under us) or was truncated in place, and if so
+// reopens it from the start.
+func (t *Tailer) checkRotated() (bool, error) {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		// The file may be momentarily missing mid-rotation; try again on
+		// the next poll instead of failing the whole tail.
+		return false, nil
+	}
+
+	rotated := !os.SameFile(fi, t.info)
+	if !rotated {
+		pos, err := t.f.Seek(0, io.SeekCurrent)
+		if err == nil && fi.Size() < pos {
+			rotated = true // truncated in place
+		}
+	}
+	if !rotated {
+		return false, nil
+	}
+
+	return true, t.openAt(io.SeekStart)
+}
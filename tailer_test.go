@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readLineWithTimeout(t *testing.T, scanner *bufio.Scanner, lines chan<- string) {
+	t.Helper()
+	go func() {
+		if scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+}
+
+func TestTailerFollowsAppends(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(path, []byte("first\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tailer, err := NewTailer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Close()
+
+	scanner := bufio.NewScanner(tailer)
+	lines := make(chan string, 1)
+	readLineWithTimeout(t, scanner, lines)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("second\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	select {
+	case got := <-lines:
+		if got != "second" {
+			t.Errorf("got %q, want %q", got, "second")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for appended line")
+	}
+}
+
+func TestTailerFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(path, []byte("before-rotate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tailer, err := NewTailer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tailer.Close()
+
+	scanner := bufio.NewScanner(tailer)
+	lines := make(chan string, 1)
+	readLineWithTimeout(t, scanner, lines)
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("after-rotate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-lines:
+		if got != "after-rotate" {
+			t.Errorf("got %q, want %q", got, "after-rotate")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for line from the rotated file")
+	}
+}